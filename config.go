@@ -0,0 +1,232 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+
+	"github.com/BurntSushi/toml"
+	"github.com/fsnotify/fsnotify"
+	"github.com/mdempsky/castle1724/schedule"
+)
+
+// Config is the daemon's full configuration: the PIM connection
+// settings, the HTTP server, and the devices, links, and schedule
+// rules it knows about.
+type Config struct {
+	Network byte
+	Dev     string
+	HTTP    string
+	MQTT    string // broker URL, e.g. "tcp://localhost:1883"; empty disables the MQTT bridge
+
+	Latitude  float64 // degrees, north positive; used for sunrise/sunset rules
+	Longitude float64 // degrees, east positive; used for sunrise/sunset rules
+
+	Devices []Device
+	Links   []Link
+	Rules   []schedule.Rule
+}
+
+type Device struct {
+	Name     string
+	ID       byte
+	Dimmable bool
+}
+
+// Link is a UPB link (aka scene): a single link ID that, when
+// activated, drives all of its member devices at once.
+type Link struct {
+	Name    string
+	ID      byte
+	Members []byte
+}
+
+// HuejackNames returns the names of everything we expose to huejack:
+// devices first, then links, in that order. Callback keys from
+// huejack index into this combined list.
+func (c *Config) HuejackNames() []string {
+	var res []string
+	for i := range c.Devices {
+		res = append(res, c.Devices[i].Name)
+	}
+	for i := range c.Links {
+		res = append(res, c.Links[i].Name)
+	}
+	return res
+}
+
+// defaultConfig is used when the daemon is run without -config.
+var defaultConfig = Config{
+	Network: 0xB4,
+	Dev:     "/dev/cu.usbserial",
+	HTTP:    ":8080",
+	Devices: []Device{
+		{"Family Lights", 1, true},
+		{"Family Fan", 2, false},
+		{"Kitchen Lights", 3, true},
+	},
+	Links: []Link{
+		{"All Off", 1, []byte{1, 2, 3}},
+		{"Movie Mode", 2, []byte{1, 3}},
+	},
+}
+
+// cfg holds the active *Config. It's swapped atomically so that
+// handlers and the rx goroutine can read it without locking, even
+// while a reload is in progress.
+var cfg atomic.Value
+
+func currentConfig() *Config {
+	return cfg.Load().(*Config)
+}
+
+// loadConfigFile reads and validates a Config from a JSON or TOML
+// file, chosen by its extension.
+func loadConfigFile(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	c := new(Config)
+	switch ext := filepath.Ext(path); ext {
+	case ".json":
+		err = json.Unmarshal(data, c)
+	case ".toml":
+		_, err = toml.Decode(string(data), c)
+	default:
+		return nil, fmt.Errorf("unrecognized config file extension %q", ext)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("parsing %s: %v", path, err)
+	}
+
+	if err := validateConfig(c); err != nil {
+		return nil, fmt.Errorf("validating %s: %v", path, err)
+	}
+	return c, nil
+}
+
+// validateConfig checks for the mistakes a hand-edited config file
+// is prone to: missing settings, duplicate IDs, and links that refer
+// to devices that don't exist.
+func validateConfig(c *Config) error {
+	if c.Network == 0 {
+		return fmt.Errorf("network ID must be nonzero")
+	}
+	if c.Dev == "" {
+		return fmt.Errorf("dev must be set")
+	}
+	if c.HTTP == "" {
+		return fmt.Errorf("http must be set")
+	}
+
+	devIDs := make(map[byte]bool)
+	for _, d := range c.Devices {
+		if d.ID == 0 {
+			return fmt.Errorf("device %q: ID must be nonzero", d.Name)
+		}
+		if devIDs[d.ID] {
+			return fmt.Errorf("device %q: duplicate ID %d", d.Name, d.ID)
+		}
+		devIDs[d.ID] = true
+	}
+
+	linkIDs := make(map[byte]bool)
+	for _, l := range c.Links {
+		if l.ID == 0 {
+			return fmt.Errorf("link %q: ID must be nonzero", l.Name)
+		}
+		if linkIDs[l.ID] {
+			return fmt.Errorf("link %q: duplicate ID %d", l.Name, l.ID)
+		}
+		linkIDs[l.ID] = true
+		for _, m := range l.Members {
+			if !devIDs[m] {
+				return fmt.Errorf("link %q: unknown member device ID %d", l.Name, m)
+			}
+		}
+	}
+
+	if err := schedule.ValidateRules(c.Rules); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// applyConfig atomically swaps in c. Network and Dev are read once at
+// startup to open the PIM connection, Rules are read once at startup
+// to build the Scheduler, and the device/link list is registered with
+// huejack once at startup, so changing any of those in a reloaded
+// config requires restarting the daemon: huejack.Handle isn't safe to
+// call again here, since it mutates package-level state with no
+// synchronization against the handlers huejack.ListenAndServe is
+// already serving concurrently.
+func applyConfig(c *Config) {
+	old, ok := cfg.Load().(*Config)
+	if ok && (c.Network != old.Network || c.Dev != old.Dev) {
+		logf("config: network/dev changed; restart to take effect")
+	}
+	if ok && !equalStrings(c.HuejackNames(), old.HuejackNames()) {
+		logf("config: device/link list changed; restart to take effect")
+	}
+	cfg.Store(c)
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// watchConfig watches path for changes and hot-reloads cfg whenever
+// it's modified. It watches the containing directory rather than the
+// file itself, so that editors that replace the file via rename
+// (instead of writing in place) are still picked up.
+func watchConfig(path string) {
+	w, err := fsnotify.NewWatcher()
+	if err != nil {
+		logf("config: starting watcher: %v", err)
+		return
+	}
+	defer w.Close()
+
+	if err := w.Add(filepath.Dir(path)); err != nil {
+		logf("config: watching %s: %v", path, err)
+		return
+	}
+
+	for {
+		select {
+		case ev, ok := <-w.Events:
+			if !ok {
+				return
+			}
+			if filepath.Clean(ev.Name) != filepath.Clean(path) || ev.Op&(fsnotify.Write|fsnotify.Create) == 0 {
+				continue
+			}
+			c, err := loadConfigFile(path)
+			if err != nil {
+				logf("config: reload failed: %v", err)
+				continue
+			}
+			applyConfig(c)
+			logf("config: reloaded from %s", path)
+
+		case err, ok := <-w.Errors:
+			if !ok {
+				return
+			}
+			logf("config: watcher error: %v", err)
+		}
+	}
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"encoding/hex"
+	"encoding/json"
 	"flag"
 	"fmt"
 	"html/template"
@@ -17,75 +18,94 @@ import (
 	"github.com/mdempsky/huejack"
 )
 
-type Config struct {
-	Devices []Device
-}
-
-type Device struct {
-	Name     string
-	ID       byte
-	Dimmable bool
-}
-
-const netID = 0xB4
-
-var cfg = Config{
-	Devices: []Device{
-		{"Family Lights", 1, true},
-		{"Family Fan", 2, false},
-		{"Kitchen Lights", 3, true},
-	},
-}
-
-func (c *Config) DeviceNames() []string {
-	var res []string
-	for i := range c.Devices {
-		res = append(res, c.Devices[i].Name)
-	}
-	return res
-}
-
 var conn *upb.Conn
 
 var (
-	devFlag  = flag.String("dev", "/dev/cu.usbserial", "serial device file")
-	httpFlag = flag.String("http", ":8080", "HTTP service address")
+	devFlag    = flag.String("dev", "/dev/cu.usbserial", "serial device file")
+	httpFlag   = flag.String("http", ":8080", "HTTP service address")
+	configFlag = flag.String("config", "", "path to JSON or TOML config file (overrides -dev, -http, and the built-in device list)")
 )
 
 func main() {
 	flag.Parse()
 
+	c := defaultConfig
+	if *configFlag != "" {
+		loaded, err := loadConfigFile(*configFlag)
+		if err != nil {
+			log.Fatalf("loading config: %v", err)
+		}
+		c = *loaded
+	} else {
+		c.Dev = *devFlag
+		c.HTTP = *httpFlag
+	}
+	cfg.Store(&c)
+
 	var err error
-	conn, err = upb.Open(*devFlag, &upb.Config{
-		Network: netID,
+	conn, err = upb.Open(c.Dev, &upb.Config{
+		Network: c.Network,
 		Logf:    logf,
 		RX:      rxUPB,
+		OnState: onDeviceState,
 	})
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	huejack.Handle(cfg.DeviceNames(), func(key, val int) {
-		dev := &cfg.Devices[key]
-		fmt.Printf("setting light %v (%q) to %v\n", key, dev.Name, val)
-		conn.Goto(dev.ID, byte((val*100+128)/256))
-	})
+	huejack.Handle(c.HuejackNames(), huejackCallback)
 	go huejack.ListenAndServe()
 
+	startMQTT(&c)
+	startSchedule(&c)
+
+	if *configFlag != "" {
+		go watchConfig(*configFlag)
+	}
+
+	// Prime the state cache with each device's current level.
+	for i := range c.Devices {
+		conn.ReportState(c.Devices[i].ID)
+	}
+
 	http.HandleFunc("/", indexHandler)
 	http.HandleFunc("/set", setHandler)
+	http.HandleFunc("/scene", sceneHandler)
 	http.HandleFunc("/cmd", cmdHandler)
 	http.HandleFunc("/send", sendHandler)
+	http.HandleFunc("/api/devices", devicesHandler)
+	http.HandleFunc("/schedule", scheduleHandler)
+	http.HandleFunc("/schedule/run", scheduleRunHandler)
 	http.Handle("/log", logStreamer)
-	go http.ListenAndServe(*httpFlag, nil)
+	http.Handle("/events", eventStreamer)
+	go http.ListenAndServe(c.HTTP, nil)
 
 	log.Println("running")
 	runtime.Goexit()
 }
 
+// huejackCallback handles a huejack on/off-with-brightness request
+// for the device or link at the given index into HuejackNames.
+func huejackCallback(key, val int) {
+	c := currentConfig()
+	if key < len(c.Devices) {
+		dev := &c.Devices[key]
+		fmt.Printf("setting light %v (%q) to %v\n", key, dev.Name, val)
+		gotoDevice(dev, byte((val*100+128)/256))
+		return
+	}
+	link := &c.Links[key-len(c.Devices)]
+	fmt.Printf("setting scene %v (%q) to %v\n", key, link.Name, val)
+	if val == 0 {
+		conn.DeactivateLink(link.ID)
+	} else {
+		conn.GotoLink(link.ID, byte((val*100+128)/256))
+	}
+}
+
 func indexHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "text/html; charset=utf-8")
-	index.Execute(w, &cfg)
+	index.Execute(w, currentConfig())
 }
 
 func setHandler(w http.ResponseWriter, r *http.Request) {
@@ -98,12 +118,30 @@ func setHandler(w http.ResponseWriter, r *http.Request) {
 			log.Println(err)
 		} else if v < 0 || v > 100 {
 			log.Println("value out of range:", v)
-		} else {
-			err := conn.Goto(byte(id), byte(v))
-			if err != nil {
-				log.Println(err)
-			}
+		} else if dev := findDevice(currentConfig(), byte(id)); dev != nil {
+			gotoDevice(dev, byte(v))
+		} else if err := conn.Goto(byte(id), byte(v)); err != nil {
+			log.Println(err)
+		}
+	}
+	http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
+}
+
+func sceneHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.FormValue("id"))
+	if err != nil {
+		log.Println(err)
+	} else if vStr := r.FormValue("v"); vStr != "" {
+		v, err := strconv.Atoi(vStr)
+		if err != nil {
+			log.Println(err)
+		} else if v < 0 || v > 100 {
+			log.Println("value out of range:", v)
+		} else if err := conn.GotoLink(byte(id), byte(v)); err != nil {
+			log.Println(err)
 		}
+	} else if err := conn.ActivateLink(byte(id)); err != nil {
+		log.Println(err)
 	}
 	http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
 }
@@ -118,27 +156,59 @@ legend { padding: 0.2em; }
 td a { display: block; background-color: #d8dad3; padding: 0.2em; border-radius: 0.2em; box-shadow: 0.2em 0.2em #4a4a48; color: #4a4a48; text-decoration: none; }
 td a:hover { background-color: #a4c2a5; }
 td a:active { transform: translate(0.1em, 0.1em); box-shadow: 0.1em 0.1em #4a4a48; }
+td a.active { background-color: #566246; color: #f1f2eb; }
 </style>
 <fieldset>
 <legend>Devices</legend>
 <table>
 {{range .Devices}}
+<tr data-device="{{.ID}}">
+<th>{{.Name}}
+<td><a href="/set?id={{.ID}}&v=0" data-v="0">0%</a></td>
+<td>{{if .Dimmable}}<a href="/set?id={{.ID}}&v=25" data-v="25">25%</a>{{end}}
+<td>{{if .Dimmable}}<a href="/set?id={{.ID}}&v=50" data-v="50">50%</a>{{end}}
+<td>{{if .Dimmable}}<a href="/set?id={{.ID}}&v=75" data-v="75">75%</a>{{end}}
+<td><a href="/set?id={{.ID}}&v=100" data-v="100">100%</a>
+</tr>
+{{end}}
+</table>
+</fieldset>
+<fieldset>
+<legend>Scenes</legend>
+<table>
+{{range .Links}}
 <tr>
 <th>{{.Name}}
-<td><a href="/set?id={{.ID}}&v=0">0%</a></td>
-<td>{{if .Dimmable}}<a href="/set?id={{.ID}}&v=25">25%</a>{{end}}
-<td>{{if .Dimmable}}<a href="/set?id={{.ID}}&v=50">50%</a>{{end}}
-<td>{{if .Dimmable}}<a href="/set?id={{.ID}}&v=75">75%</a>{{end}}
-<td><a href="/set?id={{.ID}}&v=100">100%</a>
+<td><a href="/scene?id={{.ID}}&v=0">0%</a></td>
+<td><a href="/scene?id={{.ID}}&v=50">50%</a></td>
+<td><a href="/scene?id={{.ID}}">Activate</a>
 </tr>
 {{end}}
 </table>
 </fieldset>
+
+<script>
+function highlight(id, level) {
+  document.querySelectorAll('tr[data-device="' + id + '"] a').forEach(function (a) {
+    a.classList.toggle('active', a.dataset.v == level);
+  });
+}
+
+fetch('/api/devices').then(function (r) { return r.json(); }).then(function (devices) {
+  devices.forEach(function (d) { highlight(d.id, d.level); });
+});
+
+var events = new EventSource('/events');
+events.onmessage = function (event) {
+  var d = JSON.parse(event.data);
+  highlight(d.id, d.level);
+};
+</script>
 `))
 
 func cmdHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "text/html; charset=utf-8")
-	cmdHTML.Execute(w, &cfg)
+	cmdHTML.Execute(w, currentConfig())
 }
 
 func sendHandler(w http.ResponseWriter, r *http.Request) {
@@ -211,18 +281,84 @@ func logf(format string, args ...interface{}) {
 	logStreamer.SendString("", "", s)
 }
 
+var eventStreamer = sse.New()
+
+// onDeviceState is called whenever conn's tracked state for a device
+// changes. It forwards the update to MQTT and to /events subscribers.
+// It's invoked synchronously from Conn.serve, so it runs in its own
+// goroutine to avoid stalling the UPB serial I/O loop on a slow MQTT
+// publish or SSE send.
+func onDeviceState(id, level byte) {
+	go func() {
+		if dev := findDevice(currentConfig(), id); dev != nil {
+			publishDeviceState(dev, level)
+		}
+
+		payload, err := json.Marshal(struct {
+			ID    byte `json:"id"`
+			Level byte `json:"level"`
+		}{id, level})
+		if err != nil {
+			logf("events: marshal error: %v", err)
+			return
+		}
+		eventStreamer.SendString("", "", string(payload))
+	}()
+}
+
+type deviceStatus struct {
+	ID       byte      `json:"id"`
+	Name     string    `json:"name"`
+	Level    byte      `json:"level"`
+	Dimmable bool      `json:"dimmable"`
+	Updated  time.Time `json:"updated"`
+}
+
+func devicesHandler(w http.ResponseWriter, r *http.Request) {
+	c := currentConfig()
+	res := make([]deviceStatus, len(c.Devices))
+	for i := range c.Devices {
+		dev := &c.Devices[i]
+		st, _ := conn.State(dev.ID)
+		res[i] = deviceStatus{
+			ID:       dev.ID,
+			Name:     dev.Name,
+			Level:    st.Level,
+			Dimmable: dev.Dimmable,
+			Updated:  st.Updated,
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(res); err != nil {
+		logf("api/devices: encode error: %v", err)
+	}
+}
+
+// findDevice returns the Device with the given ID, or nil if none of
+// c's devices match.
+func findDevice(c *Config, id byte) *Device {
+	for i := range c.Devices {
+		if c.Devices[i].ID == id {
+			return &c.Devices[i]
+		}
+	}
+	return nil
+}
+
 func rxUPB(msg []byte) {
 	go func() {
+		net := currentConfig().Network
 		switch {
-		case msg[0]&0x80 != 0 && msg[2] == netID && msg[3] == 0x0B && msg[5] == 0x20:
+		case msg[0]&0x80 != 0 && msg[2] == net && msg[3] == 0x0B && msg[5] == 0x20:
 			time.Sleep(2 * time.Second)
-			conn.Send([]byte{0x07, 0x10, netID, 0x0B, 0xFF, 0x30})
-		case msg[0]&0x80 == 0 && msg[2] == netID && msg[3] == 0xFF && msg[4] == 0x0B && msg[5] == 0x86:
+			conn.Send([]byte{0x07, 0x10, net, 0x0B, 0xFF, 0x30})
+		case msg[0]&0x80 == 0 && msg[2] == net && msg[3] == 0xFF && msg[4] == 0x0B && msg[5] == 0x86:
 			var cmd byte = 0x20
 			if msg[6] != 0 {
 				cmd = 0x21
 			}
-			conn.Send([]byte{0x07, 0x10, netID, 0x0B, 0xFF, cmd})
+			conn.Send([]byte{0x07, 0x10, net, 0x0B, 0xFF, cmd})
 		}
 	}()
 }
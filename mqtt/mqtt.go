@@ -0,0 +1,78 @@
+// Package mqtt is a small wrapper around an MQTT client connection,
+// used to bridge the daemon to brokers like Mosquitto for Home
+// Assistant / Node-RED integration.
+package mqtt
+
+import (
+	"time"
+
+	paho "github.com/eclipse/paho.mqtt.golang"
+)
+
+// Config configures a Client.
+type Config struct {
+	Broker   string // e.g. "tcp://localhost:1883"
+	ClientID string
+	Username string
+	Password string
+	Logf     func(format string, args ...interface{})
+}
+
+// Client is a connection to an MQTT broker. It reconnects
+// automatically, with backoff, if the connection is lost.
+type Client struct {
+	c    paho.Client
+	logf func(format string, args ...interface{})
+}
+
+// Open connects to the broker described by cfg.
+func Open(cfg *Config) (*Client, error) {
+	logf := cfg.Logf
+	if logf == nil {
+		logf = func(string, ...interface{}) {}
+	}
+
+	opts := paho.NewClientOptions().
+		AddBroker(cfg.Broker).
+		SetClientID(cfg.ClientID).
+		SetUsername(cfg.Username).
+		SetPassword(cfg.Password).
+		SetAutoReconnect(true).
+		SetMaxReconnectInterval(time.Minute).
+		SetConnectionLostHandler(func(_ paho.Client, err error) {
+			logf("mqtt: connection lost: %v", err)
+		}).
+		SetOnConnectHandler(func(paho.Client) {
+			logf("mqtt: connected to %s", cfg.Broker)
+		})
+
+	c := paho.NewClient(opts)
+	if token := c.Connect(); token.Wait() && token.Error() != nil {
+		return nil, token.Error()
+	}
+	return &Client{c: c, logf: logf}, nil
+}
+
+// Publish publishes payload to topic. Messages are retained, so that
+// subscribers like Home Assistant see current state immediately after
+// (re)connecting.
+func (c *Client) Publish(topic, payload string) error {
+	token := c.c.Publish(topic, 0, true, payload)
+	token.Wait()
+	return token.Error()
+}
+
+// Subscribe calls fn with the topic and payload of every message
+// received on topic.
+func (c *Client) Subscribe(topic string, fn func(topic string, payload []byte)) error {
+	token := c.c.Subscribe(topic, 0, func(_ paho.Client, m paho.Message) {
+		fn(m.Topic(), m.Payload())
+	})
+	token.Wait()
+	return token.Error()
+}
+
+// Close disconnects from the broker.
+func (c *Client) Close() {
+	c.c.Disconnect(250)
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"github.com/mdempsky/castle1724/mqtt"
+)
+
+var mqttClient *mqtt.Client
+
+// startMQTT connects to c's broker (if configured), publishes Home
+// Assistant discovery messages for every device, and subscribes to
+// each device's set topic.
+//
+// TODO(mdempsky): Topics aren't refreshed when the config is
+// hot-reloaded with a different device list; that requires a
+// restart.
+func startMQTT(c *Config) {
+	if c.MQTT == "" {
+		return
+	}
+
+	client, err := mqtt.Open(&mqtt.Config{
+		Broker:   c.MQTT,
+		ClientID: "castle1724",
+		Logf:     logf,
+	})
+	if err != nil {
+		logf("mqtt: connect to %s failed: %v", c.MQTT, err)
+		return
+	}
+	mqttClient = client
+
+	for i := range c.Devices {
+		dev := &c.Devices[i]
+
+		publishDiscovery(dev)
+
+		client.Subscribe(commandTopic(dev), func(_ string, payload []byte) {
+			switch s := string(payload); s {
+			case "ON":
+				gotoDevice(dev, 100)
+			case "OFF":
+				gotoDevice(dev, 0)
+			default:
+				logf("mqtt: unrecognized command for %s: %q", dev.Name, s)
+			}
+		})
+
+		if dev.Dimmable {
+			client.Subscribe(brightnessCommandTopic(dev), func(_ string, payload []byte) {
+				v, err := strconv.Atoi(string(payload))
+				if err != nil || v < 0 || v > 255 {
+					logf("mqtt: bad brightness for %s: %q", dev.Name, payload)
+					return
+				}
+				gotoDevice(dev, byte(v*100/255))
+			})
+		}
+	}
+}
+
+func stateTopic(dev *Device) string {
+	return fmt.Sprintf("castle1724/%s/state", dev.Name)
+}
+
+func commandTopic(dev *Device) string {
+	return fmt.Sprintf("castle1724/%s/set", dev.Name)
+}
+
+func brightnessStateTopic(dev *Device) string {
+	return stateTopic(dev) + "/brightness"
+}
+
+func brightnessCommandTopic(dev *Device) string {
+	return commandTopic(dev) + "/brightness"
+}
+
+// gotoDevice sends dev to level. conn.Goto verifies the result with a
+// ReportState, so dev's new state reaches MQTT (via onDeviceState)
+// once that verification comes back, rather than being published
+// optimistically here.
+func gotoDevice(dev *Device, level byte) {
+	if err := conn.Goto(dev.ID, level); err != nil {
+		logf("goto %s: %v", dev.Name, err)
+	}
+}
+
+// publishDeviceState publishes dev's on/off state, and brightness if
+// dev is dimmable, to MQTT. It's a no-op if the MQTT bridge isn't
+// enabled.
+func publishDeviceState(dev *Device, level byte) {
+	if mqttClient == nil {
+		return
+	}
+
+	state := "OFF"
+	if level > 0 {
+		state = "ON"
+	}
+	mqttClient.Publish(stateTopic(dev), state)
+
+	if dev.Dimmable {
+		mqttClient.Publish(brightnessStateTopic(dev), strconv.Itoa(int(level)*255/100))
+	}
+}
+
+// haDiscovery is a Home Assistant MQTT discovery config payload.
+// https://www.home-assistant.io/integrations/mqtt/#discovery-messages
+type haDiscovery struct {
+	Name                   string `json:"name"`
+	UniqueID               string `json:"unique_id"`
+	StateTopic             string `json:"state_topic"`
+	CommandTopic           string `json:"command_topic"`
+	PayloadOn              string `json:"payload_on"`
+	PayloadOff             string `json:"payload_off"`
+	BrightnessStateTopic   string `json:"brightness_state_topic,omitempty"`
+	BrightnessCommandTopic string `json:"brightness_command_topic,omitempty"`
+	BrightnessScale        int    `json:"brightness_scale,omitempty"`
+}
+
+func publishDiscovery(dev *Device) {
+	component := "switch"
+	if dev.Dimmable {
+		component = "light"
+	}
+
+	d := haDiscovery{
+		Name:         dev.Name,
+		UniqueID:     fmt.Sprintf("castle1724_%d", dev.ID),
+		StateTopic:   stateTopic(dev),
+		CommandTopic: commandTopic(dev),
+		PayloadOn:    "ON",
+		PayloadOff:   "OFF",
+	}
+	if dev.Dimmable {
+		d.BrightnessStateTopic = brightnessStateTopic(dev)
+		d.BrightnessCommandTopic = brightnessCommandTopic(dev)
+		d.BrightnessScale = 255
+	}
+
+	payload, err := json.Marshal(d)
+	if err != nil {
+		logf("mqtt: marshal discovery for %s: %v", dev.Name, err)
+		return
+	}
+	mqttClient.Publish(fmt.Sprintf("homeassistant/%s/%d/config", component, dev.ID), string(payload))
+}
@@ -0,0 +1,148 @@
+package schedule
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// cronSpec is a parsed 5-field cron expression: minute, hour,
+// day-of-month, month, and day-of-week (0 = Sunday).
+type cronSpec struct {
+	minute, hour, dom, month, dow []int
+
+	// domStar and dowStar record whether the day-of-month and
+	// day-of-week fields were "*" in the original expression. Per
+	// standard cron semantics, when both fields are restricted they're
+	// OR'd rather than AND'd (e.g. "0 9 1 * 1" means 9am on the 1st of
+	// the month OR every Monday), so match needs to know which of them
+	// were actually restricted rather than just treating "*" as "every
+	// value" like the other fields.
+	domStar, dowStar bool
+}
+
+func parseCron(expr string) (*cronSpec, error) {
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("cron expression %q: want 5 fields, got %d", expr, len(fields))
+	}
+
+	minute, err := parseCronField(fields[0], 0, 59)
+	if err != nil {
+		return nil, fmt.Errorf("minute: %v", err)
+	}
+	hour, err := parseCronField(fields[1], 0, 23)
+	if err != nil {
+		return nil, fmt.Errorf("hour: %v", err)
+	}
+	dom, err := parseCronField(fields[2], 1, 31)
+	if err != nil {
+		return nil, fmt.Errorf("day of month: %v", err)
+	}
+	month, err := parseCronField(fields[3], 1, 12)
+	if err != nil {
+		return nil, fmt.Errorf("month: %v", err)
+	}
+	dow, err := parseCronField(fields[4], 0, 6)
+	if err != nil {
+		return nil, fmt.Errorf("day of week: %v", err)
+	}
+
+	return &cronSpec{
+		minute: minute, hour: hour, dom: dom, month: month, dow: dow,
+		domStar: fields[2] == "*", dowStar: fields[4] == "*",
+	}, nil
+}
+
+// parseCronField parses one "*", "N", "N-M", or "N/step" field (or a
+// comma-separated list of them), returning the sorted set of values
+// in [min, max] it matches.
+func parseCronField(field string, min, max int) ([]int, error) {
+	var vals []int
+	for _, part := range strings.Split(field, ",") {
+		rng, step := part, 1
+		if i := strings.IndexByte(part, '/'); i >= 0 {
+			rng = part[:i]
+			n, err := strconv.Atoi(part[i+1:])
+			if err != nil || n <= 0 {
+				return nil, fmt.Errorf("invalid step %q", part)
+			}
+			step = n
+		}
+
+		lo, hi := min, max
+		switch {
+		case rng == "*":
+			// lo, hi already cover the full range.
+		case strings.Contains(rng, "-"):
+			bounds := strings.SplitN(rng, "-", 2)
+			var err error
+			if lo, err = strconv.Atoi(bounds[0]); err != nil {
+				return nil, fmt.Errorf("invalid range %q", rng)
+			}
+			if hi, err = strconv.Atoi(bounds[1]); err != nil {
+				return nil, fmt.Errorf("invalid range %q", rng)
+			}
+		default:
+			n, err := strconv.Atoi(rng)
+			if err != nil {
+				return nil, fmt.Errorf("invalid value %q", rng)
+			}
+			lo, hi = n, n
+			if rng != part {
+				// "N/step" runs from N to the end of the range.
+				hi = max
+			}
+		}
+		if lo < min || hi > max || lo > hi {
+			return nil, fmt.Errorf("value out of range [%d, %d]: %q", min, max, part)
+		}
+
+		for v := lo; v <= hi; v += step {
+			vals = append(vals, v)
+		}
+	}
+
+	sort.Ints(vals)
+	return vals, nil
+}
+
+func cronContains(vals []int, v int) bool {
+	i := sort.SearchInts(vals, v)
+	return i < len(vals) && vals[i] == v
+}
+
+func (s *cronSpec) match(t time.Time) bool {
+	if !cronContains(s.minute, t.Minute()) || !cronContains(s.hour, t.Hour()) || !cronContains(s.month, int(t.Month())) {
+		return false
+	}
+
+	domMatch := cronContains(s.dom, t.Day())
+	dowMatch := cronContains(s.dow, int(t.Weekday()))
+	switch {
+	case s.domStar && s.dowStar:
+		return true
+	case s.domStar:
+		return dowMatch
+	case s.dowStar:
+		return domMatch
+	default:
+		return domMatch || dowMatch
+	}
+}
+
+// next returns the first whole minute strictly after after that s
+// matches, or the zero Time if none occurs within the following 5
+// years (e.g. "0 0 30 2 *", which never matches; 5 years is enough to
+// cover expressions that only match in leap years, like "0 0 29 2 *").
+func (s *cronSpec) next(after time.Time) time.Time {
+	t := after.Truncate(time.Minute).Add(time.Minute)
+	for limit := t.AddDate(5, 0, 0); t.Before(limit); t = t.Add(time.Minute) {
+		if s.match(t) {
+			return t
+		}
+	}
+	return time.Time{}
+}
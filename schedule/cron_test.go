@@ -0,0 +1,117 @@
+package schedule
+
+import (
+	"testing"
+	"time"
+)
+
+func mustParseCron(t *testing.T, expr string) *cronSpec {
+	t.Helper()
+	spec, err := parseCron(expr)
+	if err != nil {
+		t.Fatalf("parseCron(%q): %v", expr, err)
+	}
+	return spec
+}
+
+func TestParseCronField(t *testing.T) {
+	tests := []struct {
+		field    string
+		min, max int
+		want     []int
+	}{
+		{"*", 0, 4, []int{0, 1, 2, 3, 4}},
+		{"3", 0, 59, []int{3}},
+		{"1-3", 0, 59, []int{1, 2, 3}},
+		{"*/15", 0, 59, []int{0, 15, 30, 45}},
+		{"1,3,2", 0, 59, []int{1, 2, 3}},
+		{"10-20/5", 0, 59, []int{10, 15, 20}},
+	}
+	for _, tt := range tests {
+		got, err := parseCronField(tt.field, tt.min, tt.max)
+		if err != nil {
+			t.Errorf("parseCronField(%q, %d, %d): %v", tt.field, tt.min, tt.max, err)
+			continue
+		}
+		if !intsEqual(got, tt.want) {
+			t.Errorf("parseCronField(%q, %d, %d) = %v, want %v", tt.field, tt.min, tt.max, got, tt.want)
+		}
+	}
+}
+
+func TestParseCronFieldErrors(t *testing.T) {
+	tests := []string{"60", "-1", "abc", "1-", "1/0"}
+	for _, field := range tests {
+		if _, err := parseCronField(field, 0, 59); err == nil {
+			t.Errorf("parseCronField(%q, 0, 59): want error, got nil", field)
+		}
+	}
+}
+
+func TestCronMatchDomDowUnrestricted(t *testing.T) {
+	// Both day-of-month and day-of-week are "*", so every day matches.
+	spec := mustParseCron(t, "0 9 * * *")
+	if !spec.match(time.Date(2026, time.January, 5, 9, 0, 0, 0, time.UTC)) {
+		t.Error("expected match when dom and dow are both unrestricted")
+	}
+}
+
+func TestCronMatchDomDowOr(t *testing.T) {
+	// "0 9 1 * 1": 9am on the 1st of the month, OR every Monday.
+	spec := mustParseCron(t, "0 9 1 * 1")
+
+	// 2026-01-01 is a Thursday: matches on day-of-month alone.
+	if !spec.match(time.Date(2026, time.January, 1, 9, 0, 0, 0, time.UTC)) {
+		t.Error("expected match on the 1st of the month even though it's not a Monday")
+	}
+	// 2026-01-05 is a Monday: matches on day-of-week alone.
+	if !spec.match(time.Date(2026, time.January, 5, 9, 0, 0, 0, time.UTC)) {
+		t.Error("expected match on a Monday even though it's not the 1st")
+	}
+	// 2026-01-06 is neither the 1st nor a Monday.
+	if spec.match(time.Date(2026, time.January, 6, 9, 0, 0, 0, time.UTC)) {
+		t.Error("expected no match on a day that is neither the 1st nor a Monday")
+	}
+}
+
+func TestCronNext(t *testing.T) {
+	spec := mustParseCron(t, "30 14 * * *")
+	after := time.Date(2026, time.January, 1, 0, 0, 0, 0, time.UTC)
+	want := time.Date(2026, time.January, 1, 14, 30, 0, 0, time.UTC)
+	if got := spec.next(after); !got.Equal(want) {
+		t.Errorf("next(%v) = %v, want %v", after, got, want)
+	}
+}
+
+func TestCronNextUnsatisfiable(t *testing.T) {
+	// There is no February 30th, ever.
+	spec := mustParseCron(t, "0 0 30 2 *")
+	if got := spec.next(time.Date(2026, time.January, 1, 0, 0, 0, 0, time.UTC)); !got.IsZero() {
+		t.Errorf("next() = %v, want zero Time for an unsatisfiable expression", got)
+	}
+}
+
+func TestCronNextLeapYearOnly(t *testing.T) {
+	// 2026 and 2027 aren't leap years; this should still find 2028-02-29.
+	spec := mustParseCron(t, "0 0 29 2 *")
+	after := time.Date(2026, time.January, 1, 0, 0, 0, 0, time.UTC)
+	got := spec.next(after)
+	if got.IsZero() {
+		t.Fatal("next() = zero Time, want a leap-year February 29th within 5 years")
+	}
+	if got.Month() != time.February || got.Day() != 29 {
+		t.Errorf("next() = %v, want a February 29th", got)
+	}
+}
+
+func intsEqual(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,278 @@
+// Package schedule runs UPB actions at times described by cron-style
+// expressions or offsets from sunrise/sunset at a fixed location.
+package schedule
+
+import (
+	"encoding/hex"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/mdempsky/castle1724/upb"
+)
+
+// ActionKind identifies what a Rule's Action does when it fires.
+type ActionKind string
+
+const (
+	ActionGoto           ActionKind = "goto"
+	ActionActivateLink   ActionKind = "activate_link"
+	ActionDeactivateLink ActionKind = "deactivate_link"
+	ActionSend           ActionKind = "send"
+)
+
+// Action is a single UPB command a Rule performs when it fires.
+type Action struct {
+	Kind ActionKind
+
+	Device byte // ActionGoto
+	Level  byte // ActionGoto
+
+	Link byte // ActionActivateLink, ActionDeactivateLink
+
+	Hex string // ActionSend: hex-encoded message, no spaces, no checksum
+}
+
+func (a Action) run(conn *upb.Conn) error {
+	switch a.Kind {
+	case ActionGoto:
+		return conn.Goto(a.Device, a.Level)
+	case ActionActivateLink:
+		return conn.ActivateLink(a.Link)
+	case ActionDeactivateLink:
+		return conn.DeactivateLink(a.Link)
+	case ActionSend:
+		msg, err := hex.DecodeString(a.Hex)
+		if err != nil {
+			return fmt.Errorf("decoding hex message: %v", err)
+		}
+		return conn.Send(msg)
+	default:
+		return fmt.Errorf("unknown action kind %q", a.Kind)
+	}
+}
+
+// SunEvent names a solar event a Rule can be scheduled relative to.
+type SunEvent string
+
+const (
+	Sunrise SunEvent = "sunrise"
+	Sunset  SunEvent = "sunset"
+)
+
+// Rule is a named trigger: either a 5-field cron-style expression, or
+// an offset from sunrise/sunset at the Scheduler's Location. Exactly
+// one of Cron or Sun must be set.
+type Rule struct {
+	Name string
+
+	// Cron is a 5-field minute/hour/day-of-month/month/day-of-week
+	// expression, e.g. "30 22 * * *"; empty if Sun is set. As in
+	// standard cron, if both day-of-month and day-of-week are
+	// restricted (not "*"), a match on either one is enough, e.g.
+	// "0 9 1 * 1" fires at 9am on the 1st of the month AND every
+	// Monday, not only when the two coincide.
+	Cron string
+
+	Sun           SunEvent // empty if Cron is set
+	OffsetMinutes int      // applied to Sun; may be negative
+
+	Action Action
+}
+
+func (r Rule) validate() error {
+	if (r.Cron == "") == (r.Sun == "") {
+		return fmt.Errorf("exactly one of Cron or Sun must be set")
+	}
+	if r.Cron != "" {
+		spec, err := parseCron(r.Cron)
+		if err != nil {
+			return err
+		}
+		if spec.next(time.Now()).IsZero() {
+			return fmt.Errorf("cron %q never matches (check day-of-month/month combination)", r.Cron)
+		}
+	} else if r.Sun != Sunrise && r.Sun != Sunset {
+		return fmt.Errorf("Sun must be %q or %q", Sunrise, Sunset)
+	}
+	switch r.Action.Kind {
+	case ActionGoto, ActionActivateLink, ActionDeactivateLink, ActionSend:
+	default:
+		return fmt.Errorf("unknown action kind %q", r.Action.Kind)
+	}
+	return nil
+}
+
+// ValidateRules reports the first malformed Rule, if any, identified
+// by name.
+func ValidateRules(rules []Rule) error {
+	for _, r := range rules {
+		if err := r.validate(); err != nil {
+			return fmt.Errorf("rule %q: %v", r.Name, err)
+		}
+	}
+	return nil
+}
+
+// Location is a point on Earth's surface, used to compute sunrise and
+// sunset times.
+type Location struct {
+	Latitude  float64 // degrees, north positive
+	Longitude float64 // degrees, east positive
+}
+
+type scheduledRule struct {
+	rule Rule
+	cron *cronSpec // non-nil if rule.Cron is set
+	next time.Time
+}
+
+func (sr *scheduledRule) scheduleAfter(loc Location, after time.Time) {
+	if sr.cron != nil {
+		sr.next = sr.cron.next(after)
+		return
+	}
+	t := loc.sunTime(after, sr.rule.Sun).Add(time.Duration(sr.rule.OffsetMinutes) * time.Minute)
+	if !t.After(after) {
+		t = loc.sunTime(after.AddDate(0, 0, 1), sr.rule.Sun).Add(time.Duration(sr.rule.OffsetMinutes) * time.Minute)
+	}
+	sr.next = t
+}
+
+// Scheduler fires each of a set of Rules' Actions against a upb.Conn
+// at its scheduled time.
+type Scheduler struct {
+	conn *upb.Conn
+	loc  Location
+	logf func(format string, args ...interface{})
+
+	mu    sync.Mutex
+	rules []scheduledRule
+}
+
+// New creates a Scheduler for rules, all of which fire against conn.
+// It returns an error if any rule is malformed.
+func New(conn *upb.Conn, loc Location, rules []Rule, logf func(format string, args ...interface{})) (*Scheduler, error) {
+	if err := ValidateRules(rules); err != nil {
+		return nil, err
+	}
+	if logf == nil {
+		logf = func(string, ...interface{}) {}
+	}
+
+	s := &Scheduler{conn: conn, loc: loc, logf: logf}
+	now := time.Now()
+	for _, r := range rules {
+		sr := scheduledRule{rule: r}
+		if r.Cron != "" {
+			spec, err := parseCron(r.Cron)
+			if err != nil {
+				return nil, fmt.Errorf("rule %q: %v", r.Name, err)
+			}
+			sr.cron = spec
+		}
+		sr.scheduleAfter(loc, now)
+		s.rules = append(s.rules, sr)
+	}
+	return s, nil
+}
+
+// Run fires due rules until the process exits. It's meant to be
+// called in its own goroutine.
+//
+// Run polls rather than sleeping until the next scheduled time, so
+// that it tolerates clock jumps: each due rule is fired once and its
+// next occurrence recomputed from the current time, rather than from
+// whatever was scheduled before the jump. A clock set backward won't
+// cause a backlog of firings once it catches back up, and a clock set
+// forward skips straight to whatever's due now instead of firing
+// everything that would have happened in between.
+func (s *Scheduler) Run() {
+	const tick = 10 * time.Second
+	for {
+		time.Sleep(tick)
+		s.poll(time.Now())
+	}
+}
+
+func (s *Scheduler) poll(now time.Time) {
+	s.mu.Lock()
+	var due []int
+	for i := range s.rules {
+		sr := &s.rules[i]
+		if sr.next.IsZero() {
+			// Rule.validate rejects unsatisfiable cron expressions up
+			// front, so this shouldn't happen; treat it as "disabled"
+			// rather than "due now", so a bug here can't turn into a
+			// tick-by-tick firing storm.
+			continue
+		}
+		if now.Before(sr.next) {
+			continue
+		}
+		due = append(due, i)
+	}
+	s.mu.Unlock()
+
+	for _, i := range due {
+		s.fire(i, now)
+	}
+}
+
+// fire runs the Action for s.rules[i] and reschedules it. It's called
+// with s.mu unheld while Action.run is in flight: Action.run
+// ultimately blocks on upb.Conn.Send, which can hang indefinitely
+// against an unresponsive device, and holding the lock across that
+// would stop every other rule from ever firing again.
+func (s *Scheduler) fire(i int, now time.Time) error {
+	s.mu.Lock()
+	rule := s.rules[i].rule
+	s.mu.Unlock()
+
+	s.logf("schedule: firing %q", rule.Name)
+	err := rule.Action.run(s.conn)
+	if err != nil {
+		s.logf("schedule: %q failed: %v", rule.Name, err)
+	}
+
+	s.mu.Lock()
+	s.rules[i].scheduleAfter(s.loc, now)
+	s.mu.Unlock()
+	return err
+}
+
+// Upcoming is a Rule's name and its next scheduled fire time.
+type Upcoming struct {
+	Name string
+	Next time.Time
+}
+
+// Upcoming returns every rule's next scheduled fire time.
+func (s *Scheduler) Upcoming() []Upcoming {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	res := make([]Upcoming, len(s.rules))
+	for i, sr := range s.rules {
+		res[i] = Upcoming{Name: sr.rule.Name, Next: sr.next}
+	}
+	return res
+}
+
+// RunNow immediately fires the named rule, as if its scheduled time
+// had just arrived, and reschedules it.
+func (s *Scheduler) RunNow(name string) error {
+	s.mu.Lock()
+	i := -1
+	for j := range s.rules {
+		if s.rules[j].rule.Name == name {
+			i = j
+			break
+		}
+	}
+	s.mu.Unlock()
+	if i < 0 {
+		return fmt.Errorf("no such rule %q", name)
+	}
+	return s.fire(i, time.Now())
+}
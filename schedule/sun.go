@@ -0,0 +1,82 @@
+package schedule
+
+import (
+	"math"
+	"time"
+)
+
+// sunTime returns the UTC time of event on the UTC calendar day of
+// day, using the NOAA General Solar Position Calculations.
+// https://gml.noaa.gov/grad/solcalc/solareqns.PDF
+//
+// Near the poles, around the solstices, the sun may not rise or set
+// at all; in that case the computed hour angle saturates and the
+// returned time is solar noon (or midnight) rather than a genuine
+// sunrise/sunset.
+func (loc Location) sunTime(day time.Time, event SunEvent) time.Time {
+	day = day.UTC()
+	midnight := time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, time.UTC)
+
+	jd := julianDay(midnight) + 0.5 // Julian Day at UTC noon
+	T := (jd - 2451545.0) / 36525.0 // Julian centuries since J2000.0
+
+	L0 := normDeg(280.46646 + T*(36000.76983+T*0.0003032)) // Geom Mean Long Sun
+	M := 357.52911 + T*(35999.05029-0.0001537*T)           // Geom Mean Anom Sun
+	e := 0.016708634 - T*(0.000042037+0.0000001267*T)      // Eccent Earth Orbit
+
+	Mrad := rad(M)
+	C := math.Sin(Mrad)*(1.914602-T*(0.004817+0.000014*T)) + // Sun Eq of Ctr
+		math.Sin(2*Mrad)*(0.019993-0.000101*T) +
+		math.Sin(3*Mrad)*0.000289
+
+	trueLong := L0 + C
+	appLong := trueLong - 0.00569 - 0.00478*math.Sin(rad(125.04-1934.136*T)) // Sun App Long
+
+	meanObliq := 23 + (26+(21.448-T*(46.815+T*(0.00059-T*0.001813)))/60)/60
+	obliqCorr := meanObliq + 0.00256*math.Cos(rad(125.04-1934.136*T))
+
+	decl := math.Asin(math.Sin(rad(obliqCorr)) * math.Sin(rad(appLong))) // Sun Declination
+
+	y := math.Pow(math.Tan(rad(obliqCorr)/2), 2)
+	eqTime := 4 * deg( // Equation of Time, minutes
+		y*math.Sin(2*rad(L0))-
+			2*e*math.Sin(Mrad)+
+			4*e*y*math.Sin(Mrad)*math.Cos(2*rad(L0))-
+			0.5*y*y*math.Sin(4*rad(L0))-
+			1.25*e*e*math.Sin(2*Mrad))
+
+	latRad := rad(loc.Latitude)
+	haArg := math.Cos(rad(90.833))/(math.Cos(latRad)*math.Cos(decl)) - math.Tan(latRad)*math.Tan(decl)
+	haArg = math.Max(-1, math.Min(1, haArg)) // clamp: sun doesn't rise/set this day
+	ha := deg(math.Acos(haArg))              // Hour Angle Sunrise, degrees
+
+	solarNoon := (720 - 4*loc.Longitude - eqTime) / 1440 // fraction of the UTC day
+	offset := ha * 4 / 1440
+
+	var frac float64
+	switch event {
+	case Sunrise:
+		frac = solarNoon - offset
+	case Sunset:
+		frac = solarNoon + offset
+	default:
+		frac = solarNoon
+	}
+
+	return midnight.Add(time.Duration(frac * float64(24*time.Hour)))
+}
+
+func julianDay(t time.Time) float64 {
+	return float64(t.Unix())/86400.0 + 2440587.5
+}
+
+func rad(deg float64) float64 { return deg * math.Pi / 180 }
+func deg(rad float64) float64 { return rad * 180 / math.Pi }
+
+func normDeg(d float64) float64 {
+	d = math.Mod(d, 360)
+	if d < 0 {
+		d += 360
+	}
+	return d
+}
@@ -0,0 +1,52 @@
+package schedule
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSunTimeSunriseBeforeSunset(t *testing.T) {
+	loc := Location{Latitude: 37.7749, Longitude: -122.4194} // San Francisco
+	day := time.Date(2026, time.June, 21, 0, 0, 0, 0, time.UTC)
+
+	sunrise := loc.sunTime(day, Sunrise)
+	sunset := loc.sunTime(day, Sunset)
+	if !sunrise.Before(sunset) {
+		t.Errorf("sunrise %v is not before sunset %v", sunrise, sunset)
+	}
+}
+
+func TestSunTimeEquatorEquinoxDayLength(t *testing.T) {
+	// On the equinox, a point on the equator should see almost exactly
+	// 12 hours of daylight.
+	loc := Location{Latitude: 0, Longitude: 0}
+	day := time.Date(2026, time.March, 20, 0, 0, 0, 0, time.UTC)
+
+	sunrise := loc.sunTime(day, Sunrise)
+	sunset := loc.sunTime(day, Sunset)
+
+	// Atmospheric refraction and the sun's angular radius (the 90.833°
+	// constant in sunTime) make the actual equilux day a bit longer
+	// than a geometric 12 hours, so allow generous slack.
+	got := sunset.Sub(sunrise)
+	want := 12 * time.Hour
+	if diff := got - want; diff < 0 || diff > 10*time.Minute {
+		t.Errorf("day length = %v, want within 10m of %v", got, want)
+	}
+}
+
+func TestSunTimePolarSummerDoesNotPanic(t *testing.T) {
+	// Near the pole in midsummer the sun doesn't set; sunTime should
+	// saturate rather than panic or return NaN.
+	loc := Location{Latitude: 89, Longitude: 0}
+	day := time.Date(2026, time.June, 21, 0, 0, 0, 0, time.UTC)
+
+	sunrise := loc.sunTime(day, Sunrise)
+	sunset := loc.sunTime(day, Sunset)
+	if sunrise.IsZero() || sunset.IsZero() {
+		t.Fatalf("sunTime returned a zero Time: sunrise=%v sunset=%v", sunrise, sunset)
+	}
+	if !sunrise.Before(sunset) {
+		t.Errorf("sunrise %v is not before sunset %v", sunrise, sunset)
+	}
+}
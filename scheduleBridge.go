@@ -0,0 +1,59 @@
+package main
+
+import (
+	"html/template"
+	"log"
+	"net/http"
+
+	"github.com/mdempsky/castle1724/schedule"
+)
+
+var sched *schedule.Scheduler
+
+// startSchedule builds the Scheduler for c.Rules and starts it
+// running in its own goroutine.
+func startSchedule(c *Config) {
+	loc := schedule.Location{Latitude: c.Latitude, Longitude: c.Longitude}
+
+	s, err := schedule.New(conn, loc, c.Rules, logf)
+	if err != nil {
+		// c.Rules was already validated by validateConfig, so this
+		// shouldn't happen.
+		log.Fatalf("schedule: %v", err)
+	}
+	sched = s
+	go sched.Run()
+}
+
+func scheduleHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	scheduleHTML.Execute(w, sched.Upcoming())
+}
+
+func scheduleRunHandler(w http.ResponseWriter, r *http.Request) {
+	if err := sched.RunNow(r.FormValue("name")); err != nil {
+		log.Println(err)
+	}
+	http.Redirect(w, r, "/schedule", http.StatusTemporaryRedirect)
+}
+
+var scheduleHTML = template.Must(template.New("schedule").Parse(`
+<!doctype html>
+<meta name="viewport" content="width=device-width, initial-scale=1.0">
+<style>
+fieldset, legend { background-color: #f1f2eb; border: thin solid #566246; border-radius: 0.5em; }
+legend { padding: 0.2em; }
+</style>
+<fieldset>
+<legend>Upcoming</legend>
+<table>
+<tr><th>Rule<th>Next<th>
+{{range .}}
+<tr>
+<td>{{.Name}}
+<td>{{.Next.Format "2006-01-02 15:04:05 MST"}}
+<td><form method="post" action="/schedule/run" style="display:inline"><input type="hidden" name="name" value="{{.Name}}"><button type="submit">Run now</button></form>
+{{end}}
+</table>
+</fieldset>
+`))
@@ -11,22 +11,39 @@ import (
 	"fmt"
 	"io"
 	"runtime"
+	"sync"
+	"time"
 
 	"github.com/tarm/serial"
 )
 
 type Conn struct {
-	port io.ReadWriteCloser
-	wr   chan *req
-	net  byte
-	logf func(fmt string, args ...interface{})
-	rx   func(msg []byte)
+	port    io.ReadWriteCloser
+	wr      chan *req
+	net     byte
+	logf    func(fmt string, args ...interface{})
+	rx      func(msg []byte)
+	onState func(id, level byte)
+
+	mu    sync.Mutex
+	state map[byte]DeviceState
 }
 
 type Config struct {
 	Network byte
 	Logf    func(fmt string, args ...interface{})
 	RX      func(msg []byte)
+
+	// OnState, if set, is called whenever a device's tracked state
+	// (see Conn.State) changes.
+	OnState func(id, level byte)
+}
+
+// DeviceState is a device's last known level, as reported by a
+// Device State Report, and when it was recorded.
+type DeviceState struct {
+	Level   byte
+	Updated time.Time
 }
 
 func Open(name string, cfg *Config) (*Conn, error) {
@@ -42,11 +59,13 @@ func Open(name string, cfg *Config) (*Conn, error) {
 
 func Client(s io.ReadWriteCloser, cfg *Config) *Conn {
 	c := &Conn{
-		port: s,
-		wr:   make(chan *req),
-		net:  cfg.Network,
-		logf: cfg.Logf,
-		rx:   cfg.RX,
+		port:    s,
+		wr:      make(chan *req),
+		net:     cfg.Network,
+		logf:    cfg.Logf,
+		rx:      cfg.RX,
+		onState: cfg.OnState,
+		state:   make(map[byte]DeviceState),
 	}
 	if c.logf == nil {
 		c.logf = func(string, ...interface{}) {}
@@ -54,6 +73,9 @@ func Client(s io.ReadWriteCloser, cfg *Config) *Conn {
 	if c.rx == nil {
 		c.rx = func([]byte) {}
 	}
+	if c.onState == nil {
+		c.onState = func(byte, byte) {}
+	}
 	go c.serve()
 	// TODO(mdempsky): This finalizer won't actually work as intended,
 	// because the serve goroutine will keep c alive.
@@ -145,6 +167,11 @@ func (c *Conn) serve() {
 					// TODO(mdempsky): Handle retransmits properly.
 					continue
 				}
+				if msg[5] == 0x86 && len(msg) > 6 {
+					// 11.2.1.1. "Device State Report": msg[4] is the
+					// reporting device's ID, msg[6] its current level.
+					c.setState(msg[4], msg[6])
+				}
 				c.rx(msg)
 			}
 
@@ -194,7 +221,14 @@ func (c *Conn) Message(addr, cmd byte, args []byte) []byte {
 
 func (c *Conn) Goto(id, val byte) error {
 	// 11.1.3. "The Goto Command"
-	return c.Send(c.Message(id, 0x22, []byte{val}))
+	err := c.Send(c.Message(id, 0x22, []byte{val}))
+	if err == nil {
+		// Verify the device actually reached val, rather than assuming
+		// it from val itself: the Goto may have been rate-limited or
+		// overridden locally.
+		go c.ReportState(id)
+	}
+	return err
 }
 
 func (c *Conn) ReportState(id byte) error {
@@ -202,6 +236,58 @@ func (c *Conn) ReportState(id byte) error {
 	return c.Send(c.Message(id, 0x30, nil))
 }
 
+// setState records id's level and notifies onState.
+func (c *Conn) setState(id, level byte) {
+	c.mu.Lock()
+	c.state[id] = DeviceState{Level: level, Updated: time.Now()}
+	c.mu.Unlock()
+	c.onState(id, level)
+}
+
+// State returns id's last known state, and whether any has been
+// recorded yet.
+func (c *Conn) State(id byte) (DeviceState, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	s, ok := c.state[id]
+	return s, ok
+}
+
+// States returns a snapshot of every device's last known state.
+func (c *Conn) States() map[byte]DeviceState {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	res := make(map[byte]DeviceState, len(c.state))
+	for id, s := range c.state {
+		res[id] = s
+	}
+	return res
+}
+
+// linkMessage builds a UPB message addressed to a link instead of a
+// device, by setting the Link bit (bit 7 of the second packet byte)
+// and using link as the Destination ID.
+func (c *Conn) linkMessage(link, cmd byte, args []byte) []byte {
+	msg := c.Message(link, cmd, args)
+	msg[1] |= 0x80 // Link bit
+	return msg
+}
+
+func (c *Conn) ActivateLink(link byte) error {
+	// 11.1.1. "The Activate Link Command"
+	return c.Send(c.linkMessage(link, 0x20, nil))
+}
+
+func (c *Conn) DeactivateLink(link byte) error {
+	// 11.1.2. "The Deactivate Link Command"
+	return c.Send(c.linkMessage(link, 0x21, nil))
+}
+
+func (c *Conn) GotoLink(link, level byte) error {
+	// 11.1.3. "The Goto Command", link-addressed
+	return c.Send(c.linkMessage(link, 0x22, []byte{level}))
+}
+
 // Checksum computes a UPB Packet Checksum.
 func Checksum(msg []byte) byte {
 	// "Sum all of the bytes of the Packet Header and UPB Message fields